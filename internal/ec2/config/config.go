@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -21,7 +22,7 @@ import (
 // Config defines EC2 configuration.
 type Config struct {
 	// AWSAccountID is the AWS account ID.
-	AWSAccountID string `json:"aws-account-id,omitempty"`
+	AWSAccountID string `json:"aws-account-id,omitempty" secret:"true"`
 	// AWSRegion is the AWS region.
 	AWSRegion string `json:"aws-region,omitempty"`
 
@@ -37,8 +38,8 @@ type Config struct {
 	// Must be left empty.
 	// This will be overwritten by cluster name.
 	LogOutputToUploadPath       string `json:"log-output-to-upload-path,omitempty"`
-	LogOutputToUploadPathBucket string `json:"log-output-to-upload-path-bucket,omitempty"`
-	LogOutputToUploadPathURL    string `json:"log-output-to-upload-path-url,omitempty"`
+	LogOutputToUploadPathBucket string `json:"log-output-to-upload-path-bucket,omitempty" secret:"true"`
+	LogOutputToUploadPathURL    string `json:"log-output-to-upload-path-url,omitempty" secret:"true"`
 	// UploadTesterLogs is true to auto-upload log files.
 	UploadTesterLogs bool `json:"upload-tester-logs"`
 
@@ -64,9 +65,9 @@ type Config struct {
 	// and to make a backup of original configuration
 	// with the filename suffix ".backup.yaml" in the same directory.
 	ConfigPath       string    `json:"config-path,omitempty"`
-	ConfigPathBucket string    `json:"config-path-bucket,omitempty"` // read-only to user
-	ConfigPathURL    string    `json:"config-path-url,omitempty"`    // read-only to user
-	UpdatedAt        time.Time `json:"updated-at,omitempty"`         // read-only to user
+	ConfigPathBucket string    `json:"config-path-bucket,omitempty" secret:"true"` // read-only to user
+	ConfigPathURL    string    `json:"config-path-url,omitempty" secret:"true"`    // read-only to user
+	UpdatedAt        time.Time `json:"updated-at,omitempty"`                       // read-only to user
 
 	// OSDistribution is either ubuntu or Amazon Linux 2 for now.
 	OSDistribution string `json:"os-distribution,omitempty"`
@@ -83,9 +84,18 @@ type Config struct {
 	// Outputs are saved in "/var/log/cloud-init-output.log" in EC2 instance.
 	// "tail -f /var/log/cloud-init-output.log" to check the progress.
 	// Reference: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/user-data.html.
-	// Note that if both "Plugins" and "InitScript" are not empty,
-	// "InitScript" field is always appended to the scripts generated by "Plugins" field.
+	// Note that if both "Plugins" and "InitScript" are not empty, "InitScript" is
+	// wrapped as a single "text/x-shellscript" part and appended to the
+	// multipart/mixed cloud-init document rendered from "Plugins"
+	// (see "internal/ec2/config/plugins.MultipartBuilder"). If it exceeds the
+	// 16 KB EC2 user-data limit, "ValidateAndSetDefaults" gzip-compresses and
+	// base64-encodes it; see "InitScriptEncoding".
 	InitScript string `json:"init-script,omitempty"`
+	// InitScriptEncoding describes how "InitScript" is encoded; see
+	// "plugins.EncodingPlain" and "plugins.EncodingGzipBase64". Whoever sends
+	// "InitScript" as the "RunInstances" UserData field must decode it
+	// according to this value first.
+	InitScriptEncoding string `json:"init-script-encoding,omitempty"`
 	// InitScriptCreated is true once the init script has been created.
 	// This is to prevent redundant init script updates from plugins.
 	InitScriptCreated bool `json:"init-script-created"`
@@ -95,13 +105,42 @@ type Config struct {
 	// Count is the number of EC2 instances to create.
 	Count int `json:"count,omitempty"`
 
+	// RootVolumeSizeGB is the size, in GiB, of the root EBS volume.
+	// Ignored if "BlockDevices" is non-empty. Leave 0 to use the AMI default.
+	RootVolumeSizeGB int64 `json:"root-volume-size-gb,omitempty"`
+	// RootVolumeEncrypted is true to encrypt the root EBS volume.
+	// Ignored if "BlockDevices" is non-empty.
+	RootVolumeEncrypted bool `json:"root-volume-encrypted"`
+	// BlockDevices is a list of EBS volumes to attach, passed as
+	// "RunInstances" block device mappings. If empty, "RootVolumeSizeGB"
+	// and "RootVolumeEncrypted" are used to synthesize a single root
+	// volume mapping.
+	BlockDevices []BlockDeviceRequest `json:"block-devices,omitempty"`
+
 	// KeyName is the name of the key pair used for SSH access.
-	// Leave empty to create a temporary one.
+	// Leave empty to create a temporary one. Ignored if "SSMAccess" is true.
 	KeyName string `json:"key-name,omitempty"`
 	// KeyPath is the file path to the private key.
-	KeyPath       string `json:"key-path,omitempty"`
-	KeyPathBucket string `json:"key-path-bucket,omitempty"`
-	KeyPathURL    string `json:"key-path-url,omitempty"`
+	KeyPath       string `json:"key-path,omitempty" secret:"true"`
+	KeyPathBucket string `json:"key-path-bucket,omitempty" secret:"true"`
+	KeyPathURL    string `json:"key-path-url,omitempty" secret:"true"`
+
+	// IAMInstanceProfileName is the name of the IAM instance profile to
+	// attach. If "SSMAccess" is true and both this and "IAMInstanceProfileARN"
+	// are empty, "ValidateAndSetDefaults" sets it to "ID"; it only picks the
+	// name and does not create the instance profile or its role.
+	IAMInstanceProfileName string `json:"iam-instance-profile-name,omitempty"`
+	// IAMInstanceProfileARN is the ARN of the IAM instance profile to attach.
+	IAMInstanceProfileARN string `json:"iam-instance-profile-arn,omitempty"`
+	// IAMRolePolicyARNs is the list of IAM policy ARNs attached to the
+	// instance profile's role.
+	IAMRolePolicyARNs []string `json:"iam-role-policy-arns,omitempty"`
+
+	// SSMAccess is true to provision a keyless, no-SSH access mode: key-pair
+	// generation is skipped, the instance profile is granted
+	// "AmazonSSMManagedInstanceCore", and an "ssm-agent-install" plugin is
+	// added so Ubuntu AMIs get the SSM agent snap-installed.
+	SSMAccess bool `json:"ssm-access"`
 
 	// VPCID is the VPC ID to use.
 	// Leave empty to create a temporary one.
@@ -131,6 +170,63 @@ type Config struct {
 
 	// Wait is true to wait until all EC2 instances are ready.
 	Wait bool `json:"wait"`
+
+	// InstanceTypes is a list of instance types to use for a mixed-instance
+	// fleet. If more than one entry is set, or "Spot.Enable" is true,
+	// deployer issues "CreateFleet" (or "RequestSpotFleet" for spot-only
+	// fleets) instead of "RunInstances".
+	InstanceTypes []string `json:"instance-types,omitempty"`
+	// InstanceTypeWeights maps an entry in "InstanceTypes" to its fleet
+	// weight (relative to "WeightedCapacity"). Leave empty to default
+	// every instance type to a weight of "1".
+	InstanceTypeWeights map[string]float64 `json:"instance-type-weights,omitempty"`
+
+	// Spot configures spot instance requests.
+	Spot Spot `json:"spot"`
+
+	// Tags is a set of tags applied to created instances, as a
+	// "TagSpecifications" entry of resource type "instance".
+	// "ValidateAndSetDefaults" always sets, and refuses to let the user
+	// override, the managed keys in "managedTagKeys".
+	Tags map[string]string `json:"tags,omitempty"`
+	// VolumeTags is a set of tags applied to created EBS volumes, as a
+	// "TagSpecifications" entry of resource type "volume".
+	VolumeTags map[string]string `json:"volume-tags,omitempty"`
+	// NetworkInterfaceTags is a set of tags applied to created network
+	// interfaces, as a "TagSpecifications" entry of resource type
+	// "network-interface".
+	NetworkInterfaceTags map[string]string `json:"network-interface-tags,omitempty"`
+}
+
+// managedTagKeys are tag keys that "ValidateAndSetDefaults" always sets on
+// "Tags" and that the user is not allowed to override.
+var managedTagKeys = map[string]struct{}{
+	"awstester:id":          {},
+	"awstester:config-path": {},
+	"awstester:created-at":  {},
+}
+
+// Spot defines spot instance request configuration.
+// See https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/using-spot-instances.html.
+type Spot struct {
+	// Enable is true to request spot instances rather than on-demand.
+	// If "InstanceTypes" has more than one entry, or "Enable" is true,
+	// the deployer creates an EC2 fleet rather than calling "RunInstances".
+	Enable bool `json:"enable"`
+	// MaxPrice is the maximum hourly price to pay for a spot instance.
+	// Leave empty to default to the on-demand price.
+	MaxPrice string `json:"max-price,omitempty"`
+	// InterruptionBehavior is the behavior when a spot instance is interrupted.
+	// Valid values are 'terminate', 'stop', and 'hibernate'.
+	// Defaults to 'terminate'.
+	InterruptionBehavior string `json:"interruption-behavior,omitempty"`
+	// BlockDurationMinutes reserves the spot instance for the given duration.
+	// Must be a multiple of 60, between 60 and 360. Leave 0 for no reservation.
+	BlockDurationMinutes int64 `json:"block-duration-minutes,omitempty"`
+	// RequestType is the spot request type.
+	// Valid values are 'one-time' and 'persistent'.
+	// Defaults to 'one-time'.
+	RequestType string `json:"request-type,omitempty"`
 }
 
 // Instance represents an EC2 instance.
@@ -153,6 +249,24 @@ type Instance struct {
 	RootDeviceType      string               `json:"root-device-type,omitempty"`
 	SecurityGroups      []SecurityGroup      `json:"security-groups,omitempty"`
 	LaunchTime          time.Time            `json:"launch-time,omitempty"`
+
+	// SpotInstanceRequestID is the spot instance request ID, non-empty
+	// only when the instance was launched as a spot instance.
+	SpotInstanceRequestID string `json:"spot-instance-request-id,omitempty"`
+	// LifecycleType is either "spot" or "normal" (on-demand).
+	LifecycleType string `json:"lifecycle-type,omitempty"`
+	// InterruptionNotice is not populated by "ConvertEC2Instance" (the EC2 API
+	// does not surface interruption notices on "describe-instances"), and
+	// nothing in this package sets it; the "ec2-interruption-notice-poller"
+	// plugin only prints the notice on the instance itself.
+	InterruptionNotice string `json:"interruption-notice,omitempty"`
+
+	// Tags is the set of tags attached to the instance.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// IAMInstanceProfileARN is the ARN of the IAM instance profile attached
+	// to the instance.
+	IAMInstanceProfileARN string `json:"iam-instance-profile-arn,omitempty"`
 }
 
 // Instances is a list of EC2 instances.
@@ -190,6 +304,33 @@ type EBS struct {
 	VolumeID            string `json:"volume-id,omitempty"`
 }
 
+// BlockDeviceRequest defines an input-side EBS volume request, passed to
+// "RunInstances" as a block device mapping.
+type BlockDeviceRequest struct {
+	// DeviceName is the device name exposed to the instance (e.g. "/dev/sda1").
+	DeviceName string `json:"device-name,omitempty"`
+	// VolumeType is the EBS volume type.
+	// Valid values are 'gp3', 'gp2', 'io1', 'io2', 'st1', and 'sc1'.
+	VolumeType string `json:"volume-type,omitempty"`
+	// VolumeSize is the size of the volume, in GiBs.
+	VolumeSize int64 `json:"volume-size,omitempty"`
+	// IOPS is the number of I/O operations per second.
+	// Required for 'io1' and 'io2' volumes.
+	IOPS int64 `json:"iops,omitempty"`
+	// Throughput is the throughput, in MiB/s, for a 'gp3' volume.
+	// Must be between 125 and 1000.
+	Throughput int64 `json:"throughput,omitempty"`
+	// Encrypted is true to encrypt the volume.
+	Encrypted bool `json:"encrypted"`
+	// KMSKeyID is the KMS key to use for encryption.
+	// Leave empty to use the default EBS encryption key.
+	KMSKeyID string `json:"kms-key-id,omitempty"`
+	// DeleteOnTermination is true to delete the volume when the instance terminates.
+	DeleteOnTermination bool `json:"delete-on-termination"`
+	// SnapshotID is the ID of the snapshot to create the volume from.
+	SnapshotID string `json:"snapshot-id,omitempty"`
+}
+
 // SecurityGroup defines a security group.
 type SecurityGroup struct {
 	GroupName string `json:"group-name,omitempty"`
@@ -228,6 +369,14 @@ func ConvertEC2Instance(iv *ec2.Instance) (instance Instance) {
 	if iv.PublicIpAddress != nil {
 		instance.PublicIP = *iv.PublicIpAddress
 	}
+	if iv.SpotInstanceRequestId != nil {
+		instance.SpotInstanceRequestID = *iv.SpotInstanceRequestId
+	}
+	if iv.InstanceLifecycle != nil {
+		instance.LifecycleType = *iv.InstanceLifecycle
+	} else {
+		instance.LifecycleType = "normal"
+	}
 	for j := range iv.BlockDeviceMappings {
 		instance.BlockDeviceMappings[j] = BlockDeviceMapping{
 			DeviceName: *iv.BlockDeviceMappings[j].DeviceName,
@@ -244,9 +393,38 @@ func ConvertEC2Instance(iv *ec2.Instance) (instance Instance) {
 			GroupID:   *iv.SecurityGroups[j].GroupId,
 		}
 	}
+	if len(iv.Tags) > 0 {
+		instance.Tags = make(map[string]string, len(iv.Tags))
+		for _, tg := range iv.Tags {
+			instance.Tags[*tg.Key] = *tg.Value
+		}
+	}
+	if iv.IamInstanceProfile != nil && iv.IamInstanceProfile.Arn != nil {
+		instance.IAMInstanceProfileARN = *iv.IamInstanceProfile.Arn
+	}
 	return instance
 }
 
+// FindInstancesByTag returns the subset of "cfg.Instances" tagged with the
+// given key/value pair.
+func (cfg *Config) FindInstancesByTag(key, value string) []Instance {
+	found := make([]Instance, 0)
+	for _, iv := range cfg.Instances {
+		if iv.Tags[key] == value {
+			found = append(found, iv)
+		}
+	}
+	return found
+}
+
+// UsesFleet returns true if the deployer must issue "CreateFleet" (or
+// "RequestSpotFleet" for a spot-only fleet) rather than "RunInstances",
+// because more than one instance type is requested or spot instances
+// are enabled.
+func (cfg *Config) UsesFleet() bool {
+	return len(cfg.InstanceTypes) > 1 || cfg.Spot.Enable
+}
+
 // NewDefault returns a copy of the default configuration.
 func NewDefault() *Config {
 	vv := defaultConfig
@@ -291,12 +469,64 @@ var defaultConfig = Config{
 
 const envPfxAWSTesterEC2 = "AWSTESTER_EC2_"
 
+// ssmManagedInstanceCorePolicyARN is the AWS managed policy required for an
+// instance to be managed by SSM. See "Config.SSMAccess".
+const ssmManagedInstanceCorePolicyARN = "arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"
+
+// defaultRootDeviceName returns the root device name for the synthesized
+// root "BlockDeviceRequest" (see "RootVolumeSizeGB"/"RootVolumeEncrypted"),
+// guessed from "OSDistribution" since "ValidateAndSetDefaults" has no AMI
+// to query directly. Ubuntu AMIs publish "/dev/sda1" as their root device;
+// Amazon Linux 2 HVM AMIs publish "/dev/xvda".
+func defaultRootDeviceName(osDistribution string) string {
+	if strings.Contains(strings.ToLower(osDistribution), "amazon") {
+		return "/dev/xvda"
+	}
+	return "/dev/sda1"
+}
+
+// envBlockDevices is the environmental variable that overrides "BlockDevices".
+// The reflection-based loader in "UpdateFromEnvs" only understands "[]string"
+// slices, so "[]BlockDeviceRequest" is special-cased as a JSON-encoded value,
+// e.g. AWSTESTER_EC2_BLOCK_DEVICES='[{"device-name":"/dev/sda1","volume-type":"gp3","volume-size":100}]'.
+const envBlockDevices = envPfxAWSTesterEC2 + "BLOCK_DEVICES"
+
 // UpdateFromEnvs updates fields from environmental variables.
 func (cfg *Config) UpdateFromEnvs() error {
 	cc := *cfg
 
+	if sv := os.Getenv(envBlockDevices); sv != "" {
+		var bds []BlockDeviceRequest
+		if err := json.Unmarshal([]byte(sv), &bds); err != nil {
+			return fmt.Errorf("failed to parse %q (%q, %v)", sv, envBlockDevices, err)
+		}
+		cc.BlockDevices = bds
+	}
+
+	if sv := os.Getenv(envPfxAWSTesterEC2 + "TAGS"); sv != "" {
+		if cc.Tags == nil {
+			cc.Tags = make(map[string]string)
+		}
+		for _, kv := range strings.Split(sv, ",") {
+			ss := strings.SplitN(kv, "=", 2)
+			if len(ss) != 2 {
+				return fmt.Errorf("failed to parse %q (%q, expected 'k1=v1,k2=v2')", sv, envPfxAWSTesterEC2+"TAGS")
+			}
+			cc.Tags[ss[0]] = ss[1]
+		}
+	}
+
 	tp1, vv1 := reflect.TypeOf(&cc).Elem(), reflect.ValueOf(&cc).Elem()
 	for i := 0; i < tp1.NumField(); i++ {
+		switch tp1.Field(i).Name {
+		case "BlockDevices":
+			// handled above as JSON, since it is not a "[]string" slice
+			continue
+		case "Tags", "VolumeTags", "NetworkInterfaceTags", "InstanceTypeWeights":
+			// "Tags" is handled above; the rest have no env var equivalent,
+			// since they are "map[string]string"/"map[string]float64"
+			continue
+		}
 		jv := tp1.Field(i).Tag.Get("json")
 		if jv == "" {
 			continue
@@ -363,6 +593,14 @@ func (cfg *Config) UpdateFromEnvs() error {
 // And updates empty fields with default values.
 // At the end, it writes populated YAML to awstester config path.
 func (cfg *Config) ValidateAndSetDefaults() (err error) {
+	// "firstTime" is true the first time "ValidateAndSetDefaults" runs on
+	// "cfg", before "cfg.ID" is generated below. Re-validating a config
+	// loaded back from disk (see "Load"'s doc comment) is expected to
+	// succeed, so checks that only make sense on creation (e.g. rejecting
+	// the awstester-managed "Tags" keys that "cfg.Tags" itself was populated
+	// with on the first pass) are gated on it.
+	firstTime := cfg.ID == ""
+
 	if len(cfg.LogOutputs) == 0 {
 		return errors.New("EKS LogOutputs is not specified")
 	}
@@ -379,13 +617,70 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 		return errors.New("empty ImageID")
 	}
 
+	if cfg.ID == "" {
+		cfg.Tag = genTag()
+		cfg.ID = genID()
+	}
+
+	if cfg.SSMAccess {
+		hasCorePolicy := false
+		for _, arn := range cfg.IAMRolePolicyARNs {
+			if arn == ssmManagedInstanceCorePolicyARN {
+				hasCorePolicy = true
+				break
+			}
+		}
+		if !hasCorePolicy {
+			cfg.IAMRolePolicyARNs = append(cfg.IAMRolePolicyARNs, ssmManagedInstanceCorePolicyARN)
+		}
+		if cfg.IAMInstanceProfileName == "" && cfg.IAMInstanceProfileARN == "" {
+			cfg.IAMInstanceProfileName = cfg.ID
+		}
+		// "ssm-agent-install" snap-installs the agent, which is only
+		// available on Ubuntu; Amazon Linux 2 AMIs ship the SSM agent
+		// preinstalled, so there is nothing to add there.
+		if strings.Contains(strings.ToLower(cfg.OSDistribution), "ubuntu") {
+			hasSSMAgentInstall := false
+			for _, p := range cfg.Plugins {
+				if p == "ssm-agent-install" {
+					hasSSMAgentInstall = true
+					break
+				}
+			}
+			if !hasSSMAgentInstall {
+				cfg.Plugins = append(cfg.Plugins, "ssm-agent-install")
+			}
+		}
+	}
+
+	if cfg.Spot.Enable {
+		hasInterruptionPoller := false
+		for _, p := range cfg.Plugins {
+			if p == "ec2-interruption-notice-poller" {
+				hasInterruptionPoller = true
+				break
+			}
+		}
+		if !hasInterruptionPoller {
+			cfg.Plugins = append(cfg.Plugins, "ec2-interruption-notice-poller")
+		}
+	}
+
 	if len(cfg.Plugins) > 0 && !cfg.InitScriptCreated {
 		txt := cfg.InitScript
-		cfg.InitScript, err = plugins.Create(cfg.UserName, cfg.Plugins)
+		parts, perr := plugins.Create(cfg.UserName, cfg.Plugins)
+		if perr != nil {
+			return perr
+		}
+		mb := plugins.NewMultipartBuilder()
+		for _, p := range parts {
+			mb.Add(p)
+		}
+		mb.AddLegacyScript(txt)
+		cfg.InitScript, cfg.InitScriptEncoding, err = mb.Build()
 		if err != nil {
 			return err
 		}
-		cfg.InitScript += "\n" + txt
 		cfg.InitScriptCreated = true
 	}
 
@@ -396,9 +691,83 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 		return errors.New("wrong Count")
 	}
 
-	if cfg.ID == "" {
-		cfg.Tag = genTag()
-		cfg.ID = genID()
+	if firstTime {
+		for k := range cfg.Tags {
+			if _, ok := managedTagKeys[k]; ok {
+				return fmt.Errorf("Tags key %q is reserved for awstester and cannot be set by the user", k)
+			}
+		}
+	}
+
+	synthesizedRootVolume := false
+	if len(cfg.BlockDevices) == 0 && (cfg.RootVolumeSizeGB > 0 || cfg.RootVolumeEncrypted) {
+		cfg.BlockDevices = []BlockDeviceRequest{
+			{
+				DeviceName:          defaultRootDeviceName(cfg.OSDistribution),
+				VolumeType:          "gp3",
+				VolumeSize:          cfg.RootVolumeSizeGB,
+				Encrypted:           cfg.RootVolumeEncrypted,
+				DeleteOnTermination: true,
+			},
+		}
+		synthesizedRootVolume = true
+	}
+	for _, bd := range cfg.BlockDevices {
+		switch bd.VolumeType {
+		case "gp3", "gp2", "io1", "io2", "st1", "sc1":
+		default:
+			return fmt.Errorf("unexpected BlockDevices VolumeType %q", bd.VolumeType)
+		}
+		if (bd.VolumeType == "io1" || bd.VolumeType == "io2") && bd.IOPS <= 0 {
+			return fmt.Errorf("BlockDevices VolumeType %q requires IOPS", bd.VolumeType)
+		}
+		if bd.VolumeType == "gp3" && bd.Throughput != 0 && (bd.Throughput < 125 || bd.Throughput > 1000) {
+			return fmt.Errorf("BlockDevices Throughput %d is out of the gp3 range [125, 1000]", bd.Throughput)
+		}
+		// a zero "VolumeSize" on the synthesized root mapping means
+		// "RootVolumeSizeGB" was left at its default, i.e. use the AMI's
+		// own snapshot size, per "RootVolumeSizeGB"'s doc comment
+		if bd.SnapshotID == "" && bd.VolumeSize <= 0 && !synthesizedRootVolume {
+			return fmt.Errorf("BlockDevices entry %q has no VolumeSize and no SnapshotID", bd.DeviceName)
+		}
+	}
+
+	for _, it := range cfg.InstanceTypes {
+		if _, ok := ec2types.InstanceTypes[it]; !ok {
+			return fmt.Errorf("unexpected InstanceTypes entry %q", it)
+		}
+	}
+
+	if cfg.Spot.Enable {
+		if cfg.Spot.InterruptionBehavior == "" {
+			cfg.Spot.InterruptionBehavior = "terminate"
+		}
+		switch cfg.Spot.InterruptionBehavior {
+		case "terminate", "stop", "hibernate":
+		default:
+			return fmt.Errorf("unexpected Spot.InterruptionBehavior %q", cfg.Spot.InterruptionBehavior)
+		}
+		if cfg.Spot.InterruptionBehavior == "hibernate" && !strings.Contains(strings.ToLower(cfg.OSDistribution), "amazon") {
+			return fmt.Errorf("Spot.InterruptionBehavior 'hibernate' requires an Amazon Linux 2 hibernation-enabled AMI, got OSDistribution %q", cfg.OSDistribution)
+		}
+		if cfg.Spot.RequestType == "" {
+			cfg.Spot.RequestType = "one-time"
+		}
+		switch cfg.Spot.RequestType {
+		case "one-time", "persistent":
+		default:
+			return fmt.Errorf("unexpected Spot.RequestType %q", cfg.Spot.RequestType)
+		}
+		if cfg.Spot.MaxPrice != "" {
+			mp, perr := strconv.ParseFloat(cfg.Spot.MaxPrice, 64)
+			if perr != nil || mp <= 0 {
+				return fmt.Errorf("invalid Spot.MaxPrice %q", cfg.Spot.MaxPrice)
+			}
+		}
+		if cfg.Spot.BlockDurationMinutes != 0 &&
+			(cfg.Spot.BlockDurationMinutes < 60 || cfg.Spot.BlockDurationMinutes > 360 || cfg.Spot.BlockDurationMinutes%60 != 0) {
+			return fmt.Errorf("Spot.BlockDurationMinutes %d must be 0, or a multiple of 60 between 60 and 360", cfg.Spot.BlockDurationMinutes)
+		}
 	}
 
 	if cfg.ConfigPath == "" {
@@ -414,6 +783,15 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 		cfg.ConfigPathURL = genS3URL(cfg.AWSRegion, cfg.Tag, cfg.ConfigPathBucket)
 	}
 
+	if cfg.Tags == nil {
+		cfg.Tags = make(map[string]string)
+	}
+	cfg.Tags["awstester:id"] = cfg.ID
+	cfg.Tags["awstester:config-path"] = cfg.ConfigPath
+	if _, ok := cfg.Tags["awstester:created-at"]; !ok {
+		cfg.Tags["awstester:created-at"] = time.Now().UTC().Format(time.RFC3339)
+	}
+
 	cfg.LogOutputToUploadPath = filepath.Join(os.TempDir(), fmt.Sprintf("%s.log", cfg.ID))
 	logOutputExist := false
 	for _, lv := range cfg.LogOutputs {
@@ -429,7 +807,7 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 	cfg.LogOutputToUploadPathBucket = filepath.Join(cfg.ID, "awstester-ec2.log")
 	cfg.LogOutputToUploadPathURL = genS3URL(cfg.AWSRegion, cfg.Tag, cfg.LogOutputToUploadPathBucket)
 
-	if cfg.KeyName == "" {
+	if !cfg.SSMAccess && cfg.KeyName == "" {
 		cfg.KeyName = cfg.ID
 		var f *os.File
 		f, err = ioutil.TempFile(os.TempDir(), "awstester-ec2.key")
@@ -450,6 +828,10 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 	return nil
 }
 
+// secretsPathSuffix is appended to "ConfigPath" to derive the sibling file
+// that holds the fields tagged "secret:\"true\"" (see "Redact").
+const secretsPathSuffix = ".secrets.yaml"
+
 // Load loads configuration from YAML.
 //
 // Example usage:
@@ -462,6 +844,9 @@ func (cfg *Config) ValidateAndSetDefaults() (err error) {
 // Do not set default values in this function.
 // "ValidateAndSetDefaults" must be called separately,
 // to prevent overwriting previous data when loaded from disks.
+//
+// If a sibling "p + \".secrets.yaml\"" file exists (written by "Sync"),
+// its fields are transparently merged back into the returned "Config".
 func Load(p string) (cfg *Config, err error) {
 	var d []byte
 	d, err = ioutil.ReadFile(p)
@@ -473,6 +858,14 @@ func Load(p string) (cfg *Config, err error) {
 		return nil, err
 	}
 
+	if sd, serr := ioutil.ReadFile(p + secretsPathSuffix); serr == nil {
+		secrets := new(Config)
+		if err = gyaml.Unmarshal(sd, secrets); err != nil {
+			return nil, err
+		}
+		mergeSecretFields(cfg, secrets)
+	}
+
 	if cfg.Instances == nil {
 		cfg.Instances = make([]Instance, 0)
 	}
@@ -487,6 +880,10 @@ func Load(p string) (cfg *Config, err error) {
 }
 
 // Sync persists current configuration and states to disk.
+// Fields tagged "secret:\"true\"" are written separately to
+// "ConfigPath + \".secrets.yaml\"" (mode 0600), and zeroed out of
+// "ConfigPath" itself, so that "ConfigPath" is safe to share or upload
+// (e.g. via "UploadTesterLogs") without leaking key material.
 func (cfg *Config) Sync() (err error) {
 	if !filepath.IsAbs(cfg.ConfigPath) {
 		cfg.ConfigPath, err = filepath.Abs(cfg.ConfigPath)
@@ -495,14 +892,81 @@ func (cfg *Config) Sync() (err error) {
 		}
 	}
 	cfg.UpdatedAt = time.Now().UTC()
+
+	var ds []byte
+	ds, err = gyaml.Marshal(extractSecretFields(cfg))
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(cfg.ConfigPath+secretsPathSuffix, ds, 0600); err != nil {
+		return err
+	}
+
 	var d []byte
-	d, err = gyaml.Marshal(cfg)
+	d, err = gyaml.Marshal(cfg.Redact())
 	if err != nil {
 		return err
 	}
 	return ioutil.WriteFile(cfg.ConfigPath, d, 0600)
 }
 
+// Redact returns a deep copy of "cfg" with every field tagged
+// "secret:\"true\"" zeroed out, safe for logging or display. The copy is
+// made by a YAML round trip and shares no backing storage (maps, slices)
+// with "cfg". If that round trip fails, a shallow copy is returned instead,
+// which does share maps and slices with "cfg".
+func (cfg *Config) Redact() *Config {
+	d, err := gyaml.Marshal(cfg)
+	if err != nil {
+		// a "Config" that marshaled fine on the way in should marshal fine
+		// again; fall back to a shallow copy rather than losing the redaction
+		cp := *cfg
+		zeroSecretFields(&cp)
+		return &cp
+	}
+	cp := new(Config)
+	if err = gyaml.Unmarshal(d, cp); err != nil {
+		cp2 := *cfg
+		zeroSecretFields(&cp2)
+		return &cp2
+	}
+	zeroSecretFields(cp)
+	return cp
+}
+
+// zeroSecretFields zeroes every field of "cfg" tagged "secret:\"true\"".
+func zeroSecretFields(cfg *Config) {
+	tp, vv := reflect.TypeOf(cfg).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < tp.NumField(); i++ {
+		if tp.Field(i).Tag.Get("secret") == "true" {
+			vv.Field(i).Set(reflect.Zero(tp.Field(i).Type))
+		}
+	}
+}
+
+// extractSecretFields returns a copy of "cfg" with every field NOT tagged
+// "secret:\"true\"" zeroed out.
+func extractSecretFields(cfg *Config) *Config {
+	cp := Config{}
+	tp, dvv, svv := reflect.TypeOf(&cp).Elem(), reflect.ValueOf(&cp).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < tp.NumField(); i++ {
+		if tp.Field(i).Tag.Get("secret") == "true" {
+			dvv.Field(i).Set(svv.Field(i))
+		}
+	}
+	return &cp
+}
+
+// mergeSecretFields copies every field tagged "secret:\"true\"" from "src" into "dst".
+func mergeSecretFields(dst, src *Config) {
+	tp, dvv, svv := reflect.TypeOf(dst).Elem(), reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < tp.NumField(); i++ {
+		if tp.Field(i).Tag.Get("secret") == "true" {
+			dvv.Field(i).Set(svv.Field(i))
+		}
+	}
+}
+
 // BackupConfig stores the original awstester configuration
 // file to backup, suffixed with ".backup.yaml".
 // Otherwise, deployer will overwrite its state back to YAML.
@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// MaxUserDataBytes is the EC2 user-data size limit.
+// See https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/user-data.html.
+const MaxUserDataBytes = 16 * 1024
+
+// MultipartBuilder assembles plugin-generated "Part" values into a single
+// RFC 2045 multipart/mixed cloud-init document.
+type MultipartBuilder struct {
+	parts []Part
+}
+
+// NewMultipartBuilder returns an empty "MultipartBuilder".
+func NewMultipartBuilder() *MultipartBuilder {
+	return &MultipartBuilder{}
+}
+
+// Add appends a part to the document.
+func (b *MultipartBuilder) Add(p Part) {
+	b.parts = append(b.parts, p)
+}
+
+// AddLegacyScript wraps a raw bash script as a single "text/x-shellscript"
+// part, for backward compatibility with the previous string-based "InitScript".
+// A "#!/usr/bin/env bash" line is prepended if "script" does not start with
+// "#!". No-op if "script" is empty.
+func (b *MultipartBuilder) AddLegacyScript(script string) {
+	if script == "" {
+		return
+	}
+	if !strings.HasPrefix(script, "#!") {
+		script = "#!/usr/bin/env bash\n" + script
+	}
+	b.Add(Part{
+		ContentType: "text/x-shellscript",
+		Filename:    "legacy-init-script.sh",
+		Body:        []byte(script),
+	})
+}
+
+// EncodingPlain marks a "Build" result as the literal multipart/mixed MIME
+// document, ready to use as EC2 user-data as-is.
+const EncodingPlain = ""
+
+// EncodingGzipBase64 marks a "Build" result as gzip-compressed then
+// base64-encoded. Callers must base64-decode it before use: the decoded
+// bytes are the raw gzip-compressed document, starting with the gzip magic
+// (0x1f 0x8b) that cloud-init detects to auto-decompress user-data. The
+// base64 layer exists only so the result survives as a plain Go string
+// through "Config.InitScript", which is persisted as YAML/JSON; it must be
+// stripped before the bytes ever reach the "UserData" field.
+const EncodingGzipBase64 = "gzip+base64"
+
+// Build renders the parts as a multipart/mixed MIME document and reports how
+// the result is encoded (see "EncodingPlain", "EncodingGzipBase64"). If the
+// rendered document exceeds "MaxUserDataBytes", it is gzip-compressed and
+// base64-encoded, per cloud-init's documented support for gzip-compressed
+// user-data. Returns an empty string and "EncodingPlain" if no parts were
+// added.
+func (b *MultipartBuilder) Build() (content string, encoding string, err error) {
+	if len(b.parts) == 0 {
+		return "", EncodingPlain, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	for _, p := range b.parts {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", mime.FormatMediaType(p.ContentType, nil))
+		h.Set("MIME-Version", "1.0")
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, p.Filename))
+		w, perr := mw.CreatePart(h)
+		if perr != nil {
+			return "", EncodingPlain, perr
+		}
+		if _, perr = w.Write(p.Body); perr != nil {
+			return "", EncodingPlain, perr
+		}
+	}
+	if cerr := mw.Close(); cerr != nil {
+		return "", EncodingPlain, cerr
+	}
+
+	if buf.Len() <= MaxUserDataBytes {
+		return buf.String(), EncodingPlain, nil
+	}
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	if _, gerr := gw.Write(buf.Bytes()); gerr != nil {
+		return "", EncodingPlain, gerr
+	}
+	if gerr := gw.Close(); gerr != nil {
+		return "", EncodingPlain, gerr
+	}
+	return base64.StdEncoding.EncodeToString(gzBuf.Bytes()), EncodingGzipBase64, nil
+}
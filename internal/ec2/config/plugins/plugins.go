@@ -0,0 +1,98 @@
+// Package plugins generates the cloud-init user-data parts run on instance
+// boot, selected by the "Plugins" field of "config.Config".
+package plugins
+
+import "fmt"
+
+// Part is a single plugin-generated init-script fragment, rendered as one
+// part of a multipart/mixed cloud-init document.
+// See https://cloudinit.readthedocs.io/en/latest/topics/format.html.
+type Part struct {
+	// ContentType is the MIME content type of the part, e.g.
+	// "text/x-shellscript", "text/cloud-config", or "text/x-shellscript-per-boot".
+	ContentType string
+	// Filename is the part's filename, used by cloud-init to name the
+	// script or config file it writes to disk.
+	Filename string
+	// Body is the raw part content.
+	Body []byte
+}
+
+// generators maps a plugin name to its "Part" generator.
+var generators = map[string]func(userName string) (Part, error){
+	"update-ubuntu":                  updateUbuntu,
+	"install-go1.11.1":               installGo1111,
+	"ssm-agent-install":              ssmAgentInstall,
+	"ec2-interruption-notice-poller": interruptionNoticePoller,
+}
+
+// Create renders the given plugin names, run as "userName", into parts
+// ready to be assembled into a multipart/mixed document by "MultipartBuilder".
+func Create(userName string, pluginNames []string) ([]Part, error) {
+	parts := make([]Part, 0, len(pluginNames))
+	for _, name := range pluginNames {
+		gen, ok := generators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown plugin %q", name)
+		}
+		p, err := gen(userName)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q failed: %v", name, err)
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+func updateUbuntu(userName string) (Part, error) {
+	return Part{
+		ContentType: "text/x-shellscript",
+		Filename:    "update-ubuntu.sh",
+		Body: []byte(`#!/usr/bin/env bash
+set -e
+sudo apt-get update -y
+sudo apt-get upgrade -y
+`),
+	}, nil
+}
+
+func installGo1111(userName string) (Part, error) {
+	return Part{
+		ContentType: "text/x-shellscript",
+		Filename:    "install-go1.11.1.sh",
+		Body: []byte(fmt.Sprintf(`#!/usr/bin/env bash
+set -e
+curl -s https://storage.googleapis.com/golang/go1.11.1.linux-amd64.tar.gz | sudo tar -C /usr/local -xz
+echo 'export PATH=$PATH:/usr/local/go/bin' | sudo tee -a /home/%s/.bashrc
+`, userName)),
+	}, nil
+}
+
+// ssmAgentInstall snap-installs the SSM agent, used by "Config.SSMAccess"
+// to support keyless, no-SSH access to Ubuntu instances.
+func ssmAgentInstall(userName string) (Part, error) {
+	return Part{
+		ContentType: "text/x-shellscript",
+		Filename:    "ssm-agent-install.sh",
+		Body: []byte(`#!/usr/bin/env bash
+set -e
+sudo snap install amazon-ssm-agent --classic
+sudo snap start amazon-ssm-agent
+`),
+	}, nil
+}
+
+// interruptionNoticePoller polls the instance-metadata spot interruption
+// notice endpoint on every boot, used when "Config.Spot.Enable" is true.
+func interruptionNoticePoller(userName string) (Part, error) {
+	return Part{
+		ContentType: "text/x-shellscript-per-boot",
+		Filename:    "ec2-interruption-notice-poller.sh",
+		Body: []byte(`#!/usr/bin/env bash
+while true; do
+  curl -sf http://169.254.169.254/latest/meta-data/spot/instance-action && break
+  sleep 5
+done &
+`),
+	}, nil
+}